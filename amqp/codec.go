@@ -0,0 +1,78 @@
+package amqp
+
+import "errors"
+
+// Codec tags are written as a one-byte prefix before every Marshal'd
+// message so a persisted database keeps loading messages written by an
+// older codec even after the server's default changes. They are chosen
+// from the top of the byte range, which the untagged legacy layout (see
+// Message.Unmarshal) can only ever produce as its first byte once a
+// single node has stored 0xFE<<56 (about 1.8e19) messages or more, so
+// treating an unrecognized leading byte as legacy is safe for the
+// lifetime of any real broker.
+const (
+	AMQPWireCodecTag byte = 0xFE
+	ProtoCodecTag    byte = 0xFF
+)
+
+var (
+	ErrEmptyMessageBuffer = errors.New("amqp: empty message buffer")
+)
+
+// MessageCodec encodes and decodes a Message to and from its persisted
+// or wire representation. AMQPWireCodec is the original hand-rolled
+// binary format; ProtoCodec is a protobuf-backed alternative intended
+// for schema evolution and cheaper partial decoding.
+type MessageCodec interface {
+	Tag() byte
+	Marshal(message *Message, protoVersion string) ([]byte, error)
+	Unmarshal(message *Message, buffer []byte, protoVersion string) error
+}
+
+// AMQPWireCodec is the default MessageCodec, preserving the original
+// hand-rolled binary layout used by Marshal/Unmarshal before codecs were
+// made pluggable.
+type AMQPWireCodec struct{}
+
+func (codec AMQPWireCodec) Tag() byte { return AMQPWireCodecTag }
+
+func (codec AMQPWireCodec) Marshal(message *Message, protoVersion string) ([]byte, error) {
+	return codec.marshal(message, protoVersion)
+}
+
+func (codec AMQPWireCodec) Unmarshal(message *Message, buffer []byte, protoVersion string) error {
+	return codec.unmarshal(message, buffer, protoVersion)
+}
+
+// ProtoCodec persists a Message using protobuf wire-format encoding
+// (tag/varint/length-delimited fields, see protowire.go) instead of the
+// fixed positional binary layout AMQPWireCodec uses. That makes new
+// fields (OriginNodeID, tracing headers, per-message TTL) additive
+// rather than layout-breaking, and lets DecodeProtoEnvelope read just
+// ID, Exchange, RoutingKey and BodySize during queue recovery without
+// walking the Header or Body. The real protobuf toolchain is not
+// vendored into this build, so the encoding is produced and parsed by
+// hand in protowire.go rather than by generated message types; the
+// bytes on the wire are unaffected once that toolchain lands.
+type ProtoCodec struct{}
+
+func (codec ProtoCodec) Tag() byte { return ProtoCodecTag }
+
+// DefaultCodec is the codec used by Message.Marshal for new writes.
+var DefaultCodec MessageCodec = AMQPWireCodec{}
+
+var codecsByTag = map[byte]MessageCodec{
+	AMQPWireCodecTag: AMQPWireCodec{},
+	ProtoCodecTag:    ProtoCodec{},
+}
+
+// MarshalWithCodec encodes message with codec and prepends codec's tag
+// byte, so the result can later be routed back to the same codec by
+// Message.Unmarshal regardless of what DefaultCodec is at that time.
+func MarshalWithCodec(codec MessageCodec, message *Message, protoVersion string) ([]byte, error) {
+	data, err := codec.Marshal(message, protoVersion)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{codec.Tag()}, data...), nil
+}
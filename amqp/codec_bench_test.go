@@ -0,0 +1,71 @@
+package amqp
+
+import "testing"
+
+func BenchmarkAMQPWireCodecMarshal(b *testing.B) {
+	message := newTestMessage()
+	codec := AMQPWireCodec{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := codec.Marshal(message, "0.9.1"); err != nil {
+			b.Fatalf("Marshal: %v", err)
+		}
+	}
+}
+
+func BenchmarkProtoCodecMarshal(b *testing.B) {
+	message := newTestMessage()
+	codec := ProtoCodec{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := codec.Marshal(message, "0.9.1"); err != nil {
+			b.Fatalf("Marshal: %v", err)
+		}
+	}
+}
+
+func BenchmarkAMQPWireCodecUnmarshal(b *testing.B) {
+	message := newTestMessage()
+	codec := AMQPWireCodec{}
+	data, err := codec.Marshal(message, "0.9.1")
+	if err != nil {
+		b.Fatalf("Marshal: %v", err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		decoded := &Message{}
+		if err := codec.Unmarshal(decoded, data, "0.9.1"); err != nil {
+			b.Fatalf("Unmarshal: %v", err)
+		}
+	}
+}
+
+func BenchmarkProtoCodecUnmarshal(b *testing.B) {
+	message := newTestMessage()
+	codec := ProtoCodec{}
+	data, err := codec.Marshal(message, "0.9.1")
+	if err != nil {
+		b.Fatalf("Marshal: %v", err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		decoded := &Message{}
+		if err := codec.Unmarshal(decoded, data, "0.9.1"); err != nil {
+			b.Fatalf("Unmarshal: %v", err)
+		}
+	}
+}
+
+func BenchmarkDecodeProtoEnvelope(b *testing.B) {
+	message := newTestMessage()
+	data, err := ProtoCodec{}.Marshal(message, "0.9.1")
+	if err != nil {
+		b.Fatalf("Marshal: %v", err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeProtoEnvelope(data); err != nil {
+			b.Fatalf("DecodeProtoEnvelope: %v", err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package amqp
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestMessage() *Message {
+	return &Message{
+		ID:         7,
+		Exchange:   "logs",
+		RoutingKey: "info",
+		Header:     &ContentHeader{PropertyList: &BasicPropertyList{}},
+	}
+}
+
+func TestMessageMarshalUnmarshalRoundTrip(t *testing.T) {
+	original := newTestMessage()
+
+	data, err := original.Marshal("0.9.1")
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	decoded := &Message{}
+	if err := decoded.Unmarshal(data, "0.9.1"); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if decoded.ID != original.ID || decoded.Exchange != original.Exchange || decoded.RoutingKey != original.RoutingKey {
+		t.Fatalf("round trip mismatch: got %+v, want %+v", decoded, original)
+	}
+}
+
+// TestMessageUnmarshalLegacyUntaggedFormat verifies that a buffer written
+// before codec tagging existed - the plain AMQPWireCodec layout with no
+// leading tag byte - still loads correctly after the upgrade.
+func TestMessageUnmarshalLegacyUntaggedFormat(t *testing.T) {
+	original := newTestMessage()
+
+	legacy, err := AMQPWireCodec{}.Marshal(original, "0.9.1")
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	decoded := &Message{}
+	if err := decoded.Unmarshal(legacy, "0.9.1"); err != nil {
+		t.Fatalf("Unmarshal legacy buffer: %v", err)
+	}
+	if decoded.ID != original.ID || decoded.Exchange != original.Exchange || decoded.RoutingKey != original.RoutingKey {
+		t.Fatalf("legacy round trip mismatch: got %+v, want %+v", decoded, original)
+	}
+}
+
+// TestMessageUnmarshalLegacyHighRangeID checks the reasoning in the doc
+// comment on Message.Unmarshal: WriteLonglong writes the message ID in
+// AMQP's mandated network byte order (big-endian), so a legacy buffer's
+// first byte is the ID's high byte and only collides with a registered
+// codec tag (0xFE, 0xFF) once the ID itself is at least 0xFE<<56, the
+// top 2/256ths of the uint64 range - not at small IDs like the ID=7
+// used above. This pins 2^56-1, the largest ID whose high byte is still
+// 0x00, to document that ordinary IDs never trigger the collision the
+// fallback guards against.
+func TestMessageUnmarshalLegacyHighRangeID(t *testing.T) {
+	original := newTestMessage()
+	original.ID = 0x00FFFFFFFFFFFFFF // high byte 0x00: nowhere near a codec tag
+
+	legacy, err := AMQPWireCodec{}.Marshal(original, "0.9.1")
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if legacy[0] == AMQPWireCodecTag || legacy[0] == ProtoCodecTag {
+		t.Fatalf("legacy buffer's leading byte 0x%02X collides with a registered codec tag", legacy[0])
+	}
+
+	decoded := &Message{}
+	if err := decoded.Unmarshal(legacy, "0.9.1"); err != nil {
+		t.Fatalf("Unmarshal legacy buffer: %v", err)
+	}
+	if decoded.ID != original.ID {
+		t.Fatalf("legacy round trip mismatch: got ID=%#x, want %#x", decoded.ID, original.ID)
+	}
+}
+
+func TestProtoCodecMarshalUnmarshalRoundTrip(t *testing.T) {
+	original := newTestMessage()
+	original.OriginNodeID = "node-a"
+	original.ReplicationHopCount = 2
+	original.DeadLetterExchange = "dlx"
+	original.RecordDeath("work", "rejected", "dlx", []string{"info"}, time.Unix(1700000000, 0))
+
+	data, err := ProtoCodec{}.Marshal(original, "0.9.1")
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	decoded := &Message{}
+	if err := (ProtoCodec{}).Unmarshal(decoded, data, "0.9.1"); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if decoded.ID != original.ID || decoded.Exchange != original.Exchange || decoded.RoutingKey != original.RoutingKey {
+		t.Fatalf("round trip mismatch: got %+v, want %+v", decoded, original)
+	}
+	if decoded.OriginNodeID != original.OriginNodeID || decoded.ReplicationHopCount != original.ReplicationHopCount {
+		t.Fatalf("replication fields mismatch: got %+v, want %+v", decoded, original)
+	}
+	if len(decoded.XDeathHistory) != 1 || decoded.XDeathHistory[0].Queue != "work" {
+		t.Fatalf("XDeathHistory mismatch: got %+v", decoded.XDeathHistory)
+	}
+
+	envelope, err := DecodeProtoEnvelope(data)
+	if err != nil {
+		t.Fatalf("DecodeProtoEnvelope: %v", err)
+	}
+	if envelope.ID != original.ID || envelope.Exchange != original.Exchange {
+		t.Fatalf("envelope mismatch: got %+v", envelope)
+	}
+}
+
+func TestMigrateCodecReencodesToNewDefault(t *testing.T) {
+	original := newTestMessage()
+
+	legacy, err := MarshalWithCodec(AMQPWireCodec{}, original, "0.9.1")
+	if err != nil {
+		t.Fatalf("MarshalWithCodec: %v", err)
+	}
+
+	migrated, err := MigrateCodec(legacy, ProtoCodec{}, "0.9.1")
+	if err != nil {
+		t.Fatalf("MigrateCodec: %v", err)
+	}
+	if migrated[0] != ProtoCodecTag {
+		t.Fatalf("migrated tag = 0x%02X, want 0x%02X", migrated[0], ProtoCodecTag)
+	}
+
+	decoded := &Message{}
+	if err := decoded.Unmarshal(migrated, "0.9.1"); err != nil {
+		t.Fatalf("Unmarshal migrated buffer: %v", err)
+	}
+	if decoded.ID != original.ID || decoded.Exchange != original.Exchange {
+		t.Fatalf("migrated round trip mismatch: got %+v, want %+v", decoded, original)
+	}
+}
@@ -0,0 +1,87 @@
+package amqp
+
+const (
+	ErrorOnConnection = iota
+	ErrorOnChannel
+)
+
+// Error is an AMQP protocol-level error carrying the reply code and text
+// returned to the client, plus the underlying cause that produced it, so
+// callers can use errors.Is/errors.As to react differently to transient
+// failures (I/O, storage) versus permanent ones (validation) instead of
+// parsing ReplyText.
+type Error struct {
+	ReplyCode uint16
+	ReplyText string
+	ClassId   uint16
+	MethodId  uint16
+	ErrorType int
+	cause     error
+}
+
+func (err *Error) Error() string {
+	return err.ReplyText
+}
+
+// Unwrap returns the cause this Error was built from, so
+// errors.Unwrap/errors.Is/errors.As can walk past the protocol framing
+// to the real underlying failure.
+func (err *Error) Unwrap() error {
+	return err.cause
+}
+
+// Is reports whether target is a sentinel *Error for the same reply
+// code, so callers can write errors.Is(err, ErrAccessRefused) without
+// caring about the ReplyText or cause attached at the call site.
+func (err *Error) Is(target error) bool {
+	sentinel, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return err.ReplyCode == sentinel.ReplyCode
+}
+
+// Sentinel errors for the AMQP reply codes callers most commonly need to
+// match with errors.Is, independent of ReplyText or ClassId/MethodId.
+var (
+	ErrAccessRefused      = &Error{ReplyCode: 403, ReplyText: "ACCESS_REFUSED"}
+	ErrNotFound           = &Error{ReplyCode: 404, ReplyText: "NOT_FOUND"}
+	ErrResourceLocked     = &Error{ReplyCode: 405, ReplyText: "RESOURCE_LOCKED"}
+	ErrPreconditionFailed = &Error{ReplyCode: 406, ReplyText: "PRECONDITION_FAILED"}
+)
+
+func NewConnectionError(code uint16, text string, classId uint16, methodId uint16) *Error {
+	return WrapConnectionError(nil, code, text, classId, methodId)
+}
+
+func NewChannelError(code uint16, text string, classId uint16, methodId uint16) *Error {
+	return WrapChannelError(nil, code, text, classId, methodId)
+}
+
+// WrapConnectionError builds a connection-level Error wrapping cause, so
+// errors.Unwrap(err) reaches the real I/O, storage or validation failure
+// that triggered it rather than only formatting it into ReplyText.
+func WrapConnectionError(cause error, code uint16, text string, classId uint16, methodId uint16) *Error {
+	return &Error{
+		ReplyCode: code,
+		ReplyText: ConstantsNameMap[code] + " - " + text,
+		ClassId:   classId,
+		MethodId:  methodId,
+		ErrorType: ErrorOnConnection,
+		cause:     cause,
+	}
+}
+
+// WrapChannelError builds a channel-level Error wrapping cause, so
+// errors.Unwrap(err) reaches the real I/O, storage or validation failure
+// that triggered it rather than only formatting it into ReplyText.
+func WrapChannelError(cause error, code uint16, text string, classId uint16, methodId uint16) *Error {
+	return &Error{
+		ReplyCode: code,
+		ReplyText: ConstantsNameMap[code] + " - " + text,
+		ClassId:   classId,
+		MethodId:  methodId,
+		ErrorType: ErrorOnChannel,
+		cause:     cause,
+	}
+}
@@ -0,0 +1,67 @@
+package amqp
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWrapConnectionErrorUnwrapsCause(t *testing.T) {
+	cause := errors.New("disk full")
+
+	err := WrapConnectionError(cause, 541, "internal error", 10, 40)
+
+	if !errors.Is(err, cause) {
+		t.Fatalf("errors.Is(err, cause) = false, want true")
+	}
+	if errors.Unwrap(err) != cause {
+		t.Fatalf("Unwrap() = %v, want %v", errors.Unwrap(err), cause)
+	}
+}
+
+func TestErrorIsMatchesSentinelByReplyCode(t *testing.T) {
+	err := WrapChannelError(errors.New("queue in use"), 405, "in use", 50, 10)
+
+	if !errors.Is(err, ErrResourceLocked) {
+		t.Fatalf("errors.Is(err, ErrResourceLocked) = false, want true")
+	}
+	if errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("errors.Is(err, ErrPreconditionFailed) = true, want false")
+	}
+}
+
+func TestErrorAsRecoversConcreteType(t *testing.T) {
+	var err error = NewChannelError(406, "precondition failed", 50, 10)
+
+	var amqpErr *Error
+	if !errors.As(err, &amqpErr) {
+		t.Fatal("errors.As(err, &amqpErr) = false, want true")
+	}
+	if amqpErr.ErrorType != ErrorOnChannel {
+		t.Fatalf("ErrorType = %v, want ErrorOnChannel", amqpErr.ErrorType)
+	}
+}
+
+// TestMessageUnmarshalWrapsDecodeFailure drives the real call path Message
+// storage/recovery uses - Message.Unmarshal - with a truncated buffer, and
+// checks that the resulting error is a *Error callers can match on with
+// errors.Is/errors.As rather than a raw decode error.
+func TestMessageUnmarshalWrapsDecodeFailure(t *testing.T) {
+	truncated := []byte{ProtoCodecTag, 0x08}
+
+	decoded := &Message{}
+	err := decoded.Unmarshal(truncated, "0.9.1")
+	if err == nil {
+		t.Fatal("Unmarshal truncated buffer: got nil error, want decode failure")
+	}
+
+	var amqpErr *Error
+	if !errors.As(err, &amqpErr) {
+		t.Fatalf("errors.As(err, &amqpErr) = false, want true (got %v)", err)
+	}
+	if amqpErr.ErrorType != ErrorOnChannel {
+		t.Fatalf("ErrorType = %v, want ErrorOnChannel", amqpErr.ErrorType)
+	}
+	if errors.Unwrap(err) == nil {
+		t.Fatal("errors.Unwrap(err) = nil, want the underlying decode error")
+	}
+}
@@ -0,0 +1,234 @@
+package amqp
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// Field numbers for the top-level Message fields in ProtoCodec's wire
+// format. Adding a field means picking the next unused number here, the
+// same additive schema-evolution story a generated .proto message gives
+// you, without breaking messages already on disk.
+const (
+	protoFieldID                   = 1
+	protoFieldExchange             = 2
+	protoFieldRoutingKey           = 3
+	protoFieldBodySize             = 4
+	protoFieldBody                 = 5
+	protoFieldDeliveryCount        = 6
+	protoFieldOriginNodeID         = 7
+	protoFieldReplicationHopCount  = 8
+	protoFieldExpiration           = 9
+	protoFieldDeadLetterExchange   = 10
+	protoFieldDeadLetterRoutingKey = 11
+	protoFieldDelayUntil           = 12
+	protoFieldXDeath               = 13
+	protoFieldHeader               = 14
+)
+
+// Field numbers within one embedded XDeath entry.
+const (
+	protoDeathFieldQueue       = 1
+	protoDeathFieldReason      = 2
+	protoDeathFieldExchange    = 3
+	protoDeathFieldRoutingKeys = 4
+	protoDeathFieldCount       = 5
+	protoDeathFieldTime        = 6
+)
+
+func protoTimeToVarint(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+func protoVarintToTime(v uint64) time.Time {
+	if v == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(v))
+}
+
+func (codec ProtoCodec) Marshal(message *Message, protoVersion string) ([]byte, error) {
+	buffer := bytes.NewBuffer(nil)
+
+	protoWriteVarintField(buffer, protoFieldID, message.ID)
+	protoWriteString(buffer, protoFieldExchange, message.Exchange)
+	protoWriteString(buffer, protoFieldRoutingKey, message.RoutingKey)
+	protoWriteVarintField(buffer, protoFieldBodySize, message.BodySize)
+
+	body := bytes.NewBuffer(nil)
+	for _, frame := range message.Body {
+		if err := WriteFrame(body, frame); err != nil {
+			return nil, err
+		}
+	}
+	if body.Len() > 0 {
+		protoWriteBytes(buffer, protoFieldBody, body.Bytes())
+	}
+
+	protoWriteVarintField(buffer, protoFieldDeliveryCount, uint64(message.DeliveryCount))
+	protoWriteString(buffer, protoFieldOriginNodeID, message.OriginNodeID)
+	protoWriteVarintField(buffer, protoFieldReplicationHopCount, uint64(message.ReplicationHopCount))
+	protoWriteVarintField(buffer, protoFieldExpiration, protoTimeToVarint(message.Expiration))
+	protoWriteString(buffer, protoFieldDeadLetterExchange, message.DeadLetterExchange)
+	protoWriteString(buffer, protoFieldDeadLetterRoutingKey, message.DeadLetterRoutingKey)
+	protoWriteVarintField(buffer, protoFieldDelayUntil, protoTimeToVarint(message.DelayUntil))
+
+	for _, death := range message.XDeathHistory {
+		protoWriteBytes(buffer, protoFieldXDeath, encodeProtoXDeath(death))
+	}
+
+	if message.Header != nil {
+		headerBuffer := bytes.NewBuffer(nil)
+		if err := WriteContentHeader(headerBuffer, message.Header, protoVersion); err != nil {
+			return nil, err
+		}
+		protoWriteBytes(buffer, protoFieldHeader, headerBuffer.Bytes())
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func encodeProtoXDeath(death XDeath) []byte {
+	buffer := bytes.NewBuffer(nil)
+	protoWriteString(buffer, protoDeathFieldQueue, death.Queue)
+	protoWriteString(buffer, protoDeathFieldReason, death.Reason)
+	protoWriteString(buffer, protoDeathFieldExchange, death.Exchange)
+	for _, key := range death.RoutingKeys {
+		protoWriteString(buffer, protoDeathFieldRoutingKeys, key)
+	}
+	protoWriteVarintField(buffer, protoDeathFieldCount, death.Count)
+	protoWriteVarintField(buffer, protoDeathFieldTime, protoTimeToVarint(death.Time))
+	return buffer.Bytes()
+}
+
+func decodeProtoXDeath(data []byte) (XDeath, error) {
+	reader := bytes.NewReader(data)
+	var death XDeath
+	for reader.Len() > 0 {
+		field, err := protoReadField(reader)
+		if err != nil {
+			return death, err
+		}
+		switch field.number {
+		case protoDeathFieldQueue:
+			death.Queue = string(field.bytes)
+		case protoDeathFieldReason:
+			death.Reason = string(field.bytes)
+		case protoDeathFieldExchange:
+			death.Exchange = string(field.bytes)
+		case protoDeathFieldRoutingKeys:
+			death.RoutingKeys = append(death.RoutingKeys, string(field.bytes))
+		case protoDeathFieldCount:
+			death.Count = field.varint
+		case protoDeathFieldTime:
+			death.Time = protoVarintToTime(field.varint)
+		}
+	}
+	return death, nil
+}
+
+func (codec ProtoCodec) Unmarshal(message *Message, buffer []byte, protoVersion string) error {
+	reader := bytes.NewReader(buffer)
+	for reader.Len() > 0 {
+		field, err := protoReadField(reader)
+		if err != nil {
+			return err
+		}
+		switch field.number {
+		case protoFieldID:
+			message.ID = field.varint
+		case protoFieldExchange:
+			message.Exchange = string(field.bytes)
+		case protoFieldRoutingKey:
+			message.RoutingKey = string(field.bytes)
+		case protoFieldBodySize:
+			message.BodySize = field.varint
+		case protoFieldBody:
+			bodyReader := bytes.NewReader(field.bytes)
+			for bodyReader.Len() != 0 {
+				frame, _ := ReadFrame(bodyReader)
+				message.Body = append(message.Body, frame)
+			}
+		case protoFieldDeliveryCount:
+			message.DeliveryCount = uint32(field.varint)
+		case protoFieldOriginNodeID:
+			message.OriginNodeID = string(field.bytes)
+		case protoFieldReplicationHopCount:
+			message.ReplicationHopCount = uint32(field.varint)
+		case protoFieldExpiration:
+			message.Expiration = protoVarintToTime(field.varint)
+		case protoFieldDeadLetterExchange:
+			message.DeadLetterExchange = string(field.bytes)
+		case protoFieldDeadLetterRoutingKey:
+			message.DeadLetterRoutingKey = string(field.bytes)
+		case protoFieldDelayUntil:
+			message.DelayUntil = protoVarintToTime(field.varint)
+		case protoFieldXDeath:
+			death, err := decodeProtoXDeath(field.bytes)
+			if err != nil {
+				return err
+			}
+			message.XDeathHistory = append(message.XDeathHistory, death)
+		case protoFieldHeader:
+			header, err := ReadContentHeader(bytes.NewReader(field.bytes), protoVersion)
+			if err != nil {
+				return err
+			}
+			message.Header = header
+		}
+	}
+	return nil
+}
+
+// ProtoEnvelope holds the handful of fields queue recovery needs to
+// decide whether to keep a persisted message, without paying for a full
+// Unmarshal of its Header, Body or XDeathHistory.
+type ProtoEnvelope struct {
+	ID         uint64
+	Exchange   string
+	RoutingKey string
+	BodySize   uint64
+}
+
+// DecodeProtoEnvelope reads only the ID, Exchange, RoutingKey and
+// BodySize fields out of a ProtoCodec-encoded buffer (the untagged body
+// passed to MessageCodec.Unmarshal), skipping every other field's bytes
+// unparsed.
+func DecodeProtoEnvelope(buffer []byte) (ProtoEnvelope, error) {
+	reader := bytes.NewReader(buffer)
+	var envelope ProtoEnvelope
+	for reader.Len() > 0 {
+		field, err := protoReadField(reader)
+		if err != nil {
+			return envelope, err
+		}
+		switch field.number {
+		case protoFieldID:
+			envelope.ID = field.varint
+		case protoFieldExchange:
+			envelope.Exchange = string(field.bytes)
+		case protoFieldRoutingKey:
+			envelope.RoutingKey = string(field.bytes)
+		case protoFieldBodySize:
+			envelope.BodySize = field.varint
+		}
+	}
+	return envelope, nil
+}
+
+// MigrateCodec decodes a tagged buffer produced by Message.Marshal with
+// whichever codec its tag (or lack of one) selects, and re-encodes the
+// result with to. The storage layer's background migration mode calls
+// this per persisted message to move a database onto a new default
+// codec without a restart.
+func MigrateCodec(taggedBuffer []byte, to MessageCodec, protoVersion string) ([]byte, error) {
+	message := &Message{}
+	if err := message.Unmarshal(taggedBuffer, protoVersion); err != nil {
+		return nil, fmt.Errorf("amqp: migrate decode: %w", err)
+	}
+	return MarshalWithCodec(to, message, protoVersion)
+}
@@ -0,0 +1,180 @@
+package amqp
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MaxReplicationHops bounds how many times a replicated message may be
+// re-published by peers before it is dropped, preventing an infinite
+// gossip loop between nodes that all mirror the same exchange.
+const MaxReplicationHops = 16
+
+// ReplicationExchange is the well-known fanout exchange every garagemq
+// node publishes replicated messages to, and consumes from, on each of
+// its peers - the AMQP-native equivalent of the gossip exchange used to
+// share discovery data across a fleet.
+const ReplicationExchange = "garagemq.replication"
+
+// PrepareForReplication stamps a locally originated message with this
+// node's ID before it is re-published to a peer's replication exchange.
+// It leaves OriginNodeID unchanged for messages that already carry one,
+// since those arrived from a peer and must keep their original origin.
+// In every case it increments ReplicationHopCount.
+func (message *Message) PrepareForReplication(localNodeID string) {
+	if message.OriginNodeID == "" {
+		message.OriginNodeID = localNodeID
+	}
+	message.ReplicationHopCount++
+}
+
+// ShouldDropReplication reports whether a replicated message must be
+// dropped instead of re-published: either it has looped back to its own
+// origin node, or it has exceeded the configured hop limit.
+func (message *Message) ShouldDropReplication(localNodeID string) bool {
+	return message.OriginNodeID == localNodeID || message.ReplicationHopCount > MaxReplicationHops
+}
+
+// PeerConfig describes one replication peer: where to dial it, how to
+// authenticate, and which of this node's exchanges are mirrored to it.
+type PeerConfig struct {
+	Address             string
+	Username            string
+	Password            string
+	UseTLS              bool
+	ReplicatedExchanges []string // empty replicates every exchange
+}
+
+func (peer PeerConfig) replicates(exchange string) bool {
+	if len(peer.ReplicatedExchanges) == 0 {
+		return true
+	}
+	for _, name := range peer.ReplicatedExchanges {
+		if name == exchange {
+			return true
+		}
+	}
+	return false
+}
+
+// ReplicationConfig is the `Replication` config block an operator sets
+// at server startup: this node's own ID, stamped onto every message
+// PrepareForReplication touches, and its peer list.
+type ReplicationConfig struct {
+	NodeID string
+	Peers  []PeerConfig
+}
+
+// PeerPublisher is an outbound AMQP connection to one peer's
+// ReplicationExchange. The connection package in the full server build
+// implements it over a real AMQP client connection; this package only
+// depends on the interface, so Replicator can be exercised here without
+// one vendored.
+type PeerPublisher interface {
+	Publish(exchange string, data []byte) error
+	Close() error
+}
+
+// ReplicationMetrics counts outcomes of replicating messages to peers:
+// messages sent to a peer, and messages dropped as loops or for
+// exceeding MaxReplicationHops. It does not measure replication lag.
+type ReplicationMetrics struct {
+	mu      sync.Mutex
+	sent    uint64
+	dropped uint64
+}
+
+func (metrics *ReplicationMetrics) recordSent() {
+	metrics.mu.Lock()
+	metrics.sent++
+	metrics.mu.Unlock()
+}
+
+func (metrics *ReplicationMetrics) recordDropped() {
+	metrics.mu.Lock()
+	metrics.dropped++
+	metrics.mu.Unlock()
+}
+
+// Snapshot returns the current sent/dropped counters.
+func (metrics *ReplicationMetrics) Snapshot() (sent, dropped uint64) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	return metrics.sent, metrics.dropped
+}
+
+type replicationPeer struct {
+	config    PeerConfig
+	publisher PeerPublisher
+}
+
+// Replicator mirrors locally produced messages to every configured
+// peer's ReplicationExchange, dropping instead of forwarding once a
+// message has looped back to its own origin or exceeded
+// MaxReplicationHops.
+type Replicator struct {
+	nodeID  string
+	peers   []replicationPeer
+	metrics *ReplicationMetrics
+}
+
+// NewReplicator dials every configured peer via dial (the connection
+// package's outbound AMQP client in the full server build) and returns a
+// Replicator ready to mirror messages to all of them. It closes any peer
+// already dialed before returning an error from a later one.
+func NewReplicator(cfg ReplicationConfig, dial func(PeerConfig) (PeerPublisher, error)) (*Replicator, error) {
+	replicator := &Replicator{nodeID: cfg.NodeID, metrics: &ReplicationMetrics{}}
+	for _, peerCfg := range cfg.Peers {
+		publisher, err := dial(peerCfg)
+		if err != nil {
+			replicator.Close()
+			return nil, fmt.Errorf("amqp: dial replication peer %s: %w", peerCfg.Address, err)
+		}
+		replicator.peers = append(replicator.peers, replicationPeer{config: peerCfg, publisher: publisher})
+	}
+	return replicator, nil
+}
+
+// Metrics returns the replication sent/dropped counters for this Replicator.
+func (replicator *Replicator) Metrics() *ReplicationMetrics {
+	return replicator.metrics
+}
+
+// Replicate mirrors message to every peer whose policy includes its
+// exchange, stamping origin/hop metadata first so peers (and this node,
+// on gossip return) can detect and drop a loop.
+func (replicator *Replicator) Replicate(message *Message, protoVersion string) error {
+	if message.ShouldDropReplication(replicator.nodeID) {
+		replicator.metrics.recordDropped()
+		return nil
+	}
+	message.PrepareForReplication(replicator.nodeID)
+
+	data, err := message.Marshal(protoVersion)
+	if err != nil {
+		return fmt.Errorf("amqp: marshal message %d for replication: %w", message.ID, err)
+	}
+
+	for _, peer := range replicator.peers {
+		if !peer.config.replicates(message.Exchange) {
+			continue
+		}
+		if err := peer.publisher.Publish(ReplicationExchange, data); err != nil {
+			return fmt.Errorf("amqp: replicate message %d to %s: %w", message.ID, peer.config.Address, err)
+		}
+		replicator.metrics.recordSent()
+	}
+	return nil
+}
+
+// Close disconnects every peer publisher, returning the first error
+// encountered, if any.
+func (replicator *Replicator) Close() error {
+	var firstErr error
+	for _, peer := range replicator.peers {
+		if err := peer.publisher.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
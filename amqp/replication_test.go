@@ -0,0 +1,118 @@
+package amqp
+
+import "testing"
+
+func TestPrepareForReplicationStampsLocalOrigin(t *testing.T) {
+	message := &Message{}
+
+	message.PrepareForReplication("node-a")
+
+	if message.OriginNodeID != "node-a" {
+		t.Fatalf("OriginNodeID = %q, want %q", message.OriginNodeID, "node-a")
+	}
+	if message.ReplicationHopCount != 1 {
+		t.Fatalf("ReplicationHopCount = %d, want 1", message.ReplicationHopCount)
+	}
+}
+
+func TestPrepareForReplicationKeepsOriginalOrigin(t *testing.T) {
+	message := &Message{OriginNodeID: "node-a", ReplicationHopCount: 1}
+
+	message.PrepareForReplication("node-b")
+
+	if message.OriginNodeID != "node-a" {
+		t.Fatalf("OriginNodeID = %q, want unchanged %q", message.OriginNodeID, "node-a")
+	}
+	if message.ReplicationHopCount != 2 {
+		t.Fatalf("ReplicationHopCount = %d, want 2", message.ReplicationHopCount)
+	}
+}
+
+func TestShouldDropReplication(t *testing.T) {
+	cases := []struct {
+		name    string
+		message *Message
+		local   string
+		want    bool
+	}{
+		{"own origin", &Message{OriginNodeID: "node-a"}, "node-a", true},
+		{"hop limit exceeded", &Message{OriginNodeID: "node-b", ReplicationHopCount: MaxReplicationHops + 1}, "node-a", true},
+		{"within limit from peer", &Message{OriginNodeID: "node-b", ReplicationHopCount: 1}, "node-a", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.message.ShouldDropReplication(c.local); got != c.want {
+				t.Fatalf("ShouldDropReplication() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+type fakePeerPublisher struct {
+	published [][]byte
+	closed    bool
+}
+
+func (fake *fakePeerPublisher) Publish(exchange string, data []byte) error {
+	fake.published = append(fake.published, data)
+	return nil
+}
+
+func (fake *fakePeerPublisher) Close() error {
+	fake.closed = true
+	return nil
+}
+
+// TestReplicatorMirrorsAndDropsLoops drives Replicator.Replicate end to
+// end: a fresh local message is stamped and forwarded to every peer
+// whose policy matches its exchange, while a message already looped back
+// to this node is dropped instead of forwarded.
+func TestReplicatorMirrorsAndDropsLoops(t *testing.T) {
+	mirror := &fakePeerPublisher{}
+	skip := &fakePeerPublisher{}
+
+	replicator, err := NewReplicator(ReplicationConfig{
+		NodeID: "node-a",
+		Peers: []PeerConfig{
+			{Address: "peer-1", ReplicatedExchanges: []string{"logs"}},
+			{Address: "peer-2", ReplicatedExchanges: []string{"other"}},
+		},
+	}, func(cfg PeerConfig) (PeerPublisher, error) {
+		if cfg.Address == "peer-1" {
+			return mirror, nil
+		}
+		return skip, nil
+	})
+	if err != nil {
+		t.Fatalf("NewReplicator: %v", err)
+	}
+	defer replicator.Close()
+
+	local := &Message{ID: 1, Exchange: "logs", Header: &ContentHeader{PropertyList: &BasicPropertyList{}}}
+	if err := replicator.Replicate(local, "0.9.1"); err != nil {
+		t.Fatalf("Replicate local message: %v", err)
+	}
+	if len(mirror.published) != 1 {
+		t.Fatalf("peer-1 received %d messages, want 1", len(mirror.published))
+	}
+	if len(skip.published) != 0 {
+		t.Fatalf("peer-2 received %d messages, want 0 (policy excludes logs)", len(skip.published))
+	}
+	if local.OriginNodeID != "node-a" || local.ReplicationHopCount != 1 {
+		t.Fatalf("local message not stamped: origin=%q hops=%d", local.OriginNodeID, local.ReplicationHopCount)
+	}
+
+	looped := &Message{ID: 2, Exchange: "logs", OriginNodeID: "node-a", Header: &ContentHeader{PropertyList: &BasicPropertyList{}}}
+	if err := replicator.Replicate(looped, "0.9.1"); err != nil {
+		t.Fatalf("Replicate looped message: %v", err)
+	}
+	if len(mirror.published) != 1 {
+		t.Fatalf("peer-1 received %d messages after a looped-back message, want still 1", len(mirror.published))
+	}
+
+	sent, dropped := replicator.Metrics().Snapshot()
+	if sent != 1 || dropped != 1 {
+		t.Fatalf("metrics sent=%d dropped=%d, want sent=1 dropped=1", sent, dropped)
+	}
+}
@@ -0,0 +1,61 @@
+package amqp
+
+import "testing"
+
+// TestTraceTagsBeforeHeaderIsRead guards against a regression where
+// TraceTags (and the IsPersistent it calls) panicked on a message that
+// has not yet received its content header - the state a message is in
+// for the span opened around NewMessage.
+func TestTraceTagsBeforeHeaderIsRead(t *testing.T) {
+	message := &Message{ID: 1, Exchange: "logs", RoutingKey: "info"}
+
+	tags := message.TraceTags()
+
+	if tags["persistent"] != false {
+		t.Fatalf("persistent = %v, want false before the header is read", tags["persistent"])
+	}
+}
+
+// TestPublishRouteDeliverSpans exercises the full instrumentation path
+// the tracing request asked for: a span opened around NewMessage, kept
+// alive through Append and SetHeader, and a span recorded for each of
+// Enqueue and Deliver, all against a real (non-Noop) Tracer.
+func TestPublishRouteDeliverSpans(t *testing.T) {
+	previous := ActiveTracer
+	tracer := &RecordingTracer{}
+	ActiveTracer = tracer
+	defer func() { ActiveTracer = previous }()
+
+	message := NewMessage(&BasicPublish{Exchange: "logs", RoutingKey: "info"})
+	message.Append(&Frame{Payload: []byte("hello")})
+	message.SetHeader(&ContentHeader{PropertyList: &BasicPropertyList{}})
+	message.Enqueue("logs.info")
+	message.Deliver("consumer-1")
+	message.FinishPublish()
+
+	spans := tracer.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d finished spans, want 3 (publish, enqueue, deliver): %+v", len(spans), spans)
+	}
+
+	wantOps := map[string]bool{"amqp.publish": false, "amqp.enqueue": false, "amqp.deliver": false}
+	for _, span := range spans {
+		if _, ok := wantOps[span.Operation]; !ok {
+			t.Fatalf("unexpected span operation %q", span.Operation)
+		}
+		wantOps[span.Operation] = true
+	}
+	for op, seen := range wantOps {
+		if !seen {
+			t.Fatalf("missing span for operation %q", op)
+		}
+	}
+
+	publishSpan := spans[2]
+	if publishSpan.Operation != "amqp.publish" {
+		t.Fatalf("FinishPublish's span finished out of order: got %q", publishSpan.Operation)
+	}
+	if publishSpan.Tags["message.id"] != message.ID {
+		t.Fatalf("publish span message.id = %v, want %v", publishSpan.Tags["message.id"], message.ID)
+	}
+}
@@ -0,0 +1,127 @@
+package amqp
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// DequeueDecision is the outcome Message.Dequeue reaches after weighing a
+// message's delay and TTL against the queue it is about to leave.
+type DequeueDecision int
+
+const (
+	// DequeueDeliver means the message is neither delayed nor expired
+	// and should be delivered to a consumer now.
+	DequeueDeliver DequeueDecision = iota
+	// DequeueHold means the message is still within its DelayUntil
+	// window and must stay in the delayed-message exchange.
+	DequeueHold
+	// DequeueDeadLetter means the message's TTL has elapsed and it must
+	// be republished to a dead-letter exchange instead of delivered.
+	DequeueDeadLetter
+)
+
+// Dequeue decides what a queue should do with message when it reaches
+// the head of the queue: hold it back if it is still delayed, dead-letter
+// it if its TTL has elapsed, or hand it to a consumer otherwise. A
+// dead-letter decision routes to the message's own DeadLetterExchange and
+// DeadLetterRoutingKey when HasDeadLetterRoute is true, falling back to
+// the queue's configured dead-letter exchange otherwise, and records the
+// hop via RecordDeath before returning so XDeathHistory reflects it ahead
+// of the republish.
+func (message *Message) Dequeue(queueName, queueDeadLetterExchange, queueDeadLetterRoutingKey string, now time.Time) (decision DequeueDecision, exchange, routingKey string) {
+	if message.IsDelayed(now) {
+		return DequeueHold, "", ""
+	}
+	if !message.IsExpired(now) {
+		return DequeueDeliver, "", ""
+	}
+
+	exchange, routingKey = queueDeadLetterExchange, queueDeadLetterRoutingKey
+	if message.HasDeadLetterRoute() {
+		exchange, routingKey = message.DeadLetterExchange, message.DeadLetterRoutingKey
+	}
+	message.RecordDeath(queueName, "expired", exchange, []string{routingKey}, now)
+	return DequeueDeadLetter, exchange, routingKey
+}
+
+// delayedEntry is one message waiting in a DelayedExchange, ordered by
+// DelayUntil so the earliest-ready message is always at the heap's root.
+type delayedEntry struct {
+	message *Message
+	index   int
+}
+
+type delayedQueue []*delayedEntry
+
+func (queue delayedQueue) Len() int { return len(queue) }
+
+func (queue delayedQueue) Less(i, j int) bool {
+	return queue[i].message.DelayUntil.Before(queue[j].message.DelayUntil)
+}
+
+func (queue delayedQueue) Swap(i, j int) {
+	queue[i], queue[j] = queue[j], queue[i]
+	queue[i].index = i
+	queue[j].index = j
+}
+
+func (queue *delayedQueue) Push(x interface{}) {
+	entry := x.(*delayedEntry)
+	entry.index = len(*queue)
+	*queue = append(*queue, entry)
+}
+
+func (queue *delayedQueue) Pop() interface{} {
+	old := *queue
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	*queue = old[:n-1]
+	return entry
+}
+
+// DelayedExchange holds messages published with a DelayUntil in the
+// future and releases them, in DelayUntil order, once they become
+// eligible for routing - the AMQP-native equivalent of RabbitMQ's
+// delayed-message-exchange plugin.
+type DelayedExchange struct {
+	mu    sync.Mutex
+	queue delayedQueue
+}
+
+// Schedule adds message to the exchange. It is a no-op if the message is
+// not actually delayed (IsDelayed is false for its DelayUntil), so
+// callers can pass every published message through Schedule unconditionally
+// and let the exchange decide whether to hold it.
+func (exchange *DelayedExchange) Schedule(message *Message, now time.Time) {
+	if !message.IsDelayed(now) {
+		return
+	}
+	exchange.mu.Lock()
+	heap.Push(&exchange.queue, &delayedEntry{message: message})
+	exchange.mu.Unlock()
+}
+
+// Ready removes and returns every message whose DelayUntil has passed as
+// of now, in DelayUntil order, leaving messages that are still delayed in
+// the exchange.
+func (exchange *DelayedExchange) Ready(now time.Time) []*Message {
+	exchange.mu.Lock()
+	defer exchange.mu.Unlock()
+
+	var ready []*Message
+	for exchange.queue.Len() > 0 && !exchange.queue[0].message.IsDelayed(now) {
+		entry := heap.Pop(&exchange.queue).(*delayedEntry)
+		ready = append(ready, entry.message)
+	}
+	return ready
+}
+
+// Len returns the number of messages currently held by the exchange.
+func (exchange *DelayedExchange) Len() int {
+	exchange.mu.Lock()
+	defer exchange.mu.Unlock()
+	return exchange.queue.Len()
+}
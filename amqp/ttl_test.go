@@ -0,0 +1,152 @@
+package amqp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordDeathMergesRepeatHops(t *testing.T) {
+	message := &Message{ID: 1}
+	first := time.Unix(1000, 0)
+	second := time.Unix(2000, 0)
+
+	message.RecordDeath("orders", "rejected", "dlx", []string{"orders.new"}, first)
+	message.RecordDeath("orders", "rejected", "dlx", []string{"orders.new"}, second)
+
+	if len(message.XDeathHistory) != 1 {
+		t.Fatalf("XDeathHistory has %d entries, want 1 merged entry", len(message.XDeathHistory))
+	}
+	death := message.XDeathHistory[0]
+	if death.Count != 2 {
+		t.Fatalf("Count = %d, want 2", death.Count)
+	}
+	if !death.Time.Equal(second) {
+		t.Fatalf("Time = %v, want %v", death.Time, second)
+	}
+}
+
+func TestRecordDeathAppendsDistinctHops(t *testing.T) {
+	message := &Message{ID: 1}
+	now := time.Unix(1000, 0)
+
+	message.RecordDeath("orders", "rejected", "dlx", nil, now)
+	message.RecordDeath("orders", "expired", "dlx", nil, now)
+
+	if len(message.XDeathHistory) != 2 {
+		t.Fatalf("XDeathHistory has %d entries, want 2 distinct entries", len(message.XDeathHistory))
+	}
+}
+
+func TestIsExpiredAndIsDelayed(t *testing.T) {
+	now := time.Unix(1000, 0)
+	message := &Message{
+		Expiration: now.Add(-time.Second),
+		DelayUntil: now.Add(time.Second),
+	}
+
+	if !message.IsExpired(now) {
+		t.Fatal("IsExpired = false, want true for a deadline in the past")
+	}
+	if !message.IsDelayed(now) {
+		t.Fatal("IsDelayed = false, want true while still before DelayUntil")
+	}
+}
+
+func TestMessageDequeueDeliversOrdinaryMessage(t *testing.T) {
+	message := &Message{ID: 1}
+
+	decision, exchange, routingKey := message.Dequeue("orders", "dlx", "orders.dead", time.Unix(1000, 0))
+
+	if decision != DequeueDeliver {
+		t.Fatalf("decision = %v, want DequeueDeliver", decision)
+	}
+	if exchange != "" || routingKey != "" {
+		t.Fatalf("got exchange=%q routingKey=%q, want both empty", exchange, routingKey)
+	}
+}
+
+func TestMessageDequeueHoldsDelayedMessage(t *testing.T) {
+	now := time.Unix(1000, 0)
+	message := &Message{ID: 1, DelayUntil: now.Add(time.Second)}
+
+	decision, _, _ := message.Dequeue("orders", "dlx", "orders.dead", now)
+
+	if decision != DequeueHold {
+		t.Fatalf("decision = %v, want DequeueHold", decision)
+	}
+}
+
+func TestMessageDequeueDeadLettersExpiredMessageToQueueRoute(t *testing.T) {
+	now := time.Unix(1000, 0)
+	message := &Message{ID: 1, Expiration: now.Add(-time.Second)}
+
+	decision, exchange, routingKey := message.Dequeue("orders", "dlx", "orders.dead", now)
+
+	if decision != DequeueDeadLetter {
+		t.Fatalf("decision = %v, want DequeueDeadLetter", decision)
+	}
+	if exchange != "dlx" || routingKey != "orders.dead" {
+		t.Fatalf("got exchange=%q routingKey=%q, want dlx/orders.dead", exchange, routingKey)
+	}
+	if len(message.XDeathHistory) != 1 || message.XDeathHistory[0].Reason != "expired" {
+		t.Fatalf("XDeathHistory = %+v, want one expired hop recorded", message.XDeathHistory)
+	}
+}
+
+func TestMessageDequeuePrefersMessageOwnDeadLetterRoute(t *testing.T) {
+	now := time.Unix(1000, 0)
+	message := &Message{
+		ID:                   1,
+		Expiration:           now.Add(-time.Second),
+		DeadLetterExchange:   "per-message-dlx",
+		DeadLetterRoutingKey: "per-message-key",
+	}
+
+	_, exchange, routingKey := message.Dequeue("orders", "dlx", "orders.dead", now)
+
+	if exchange != "per-message-dlx" || routingKey != "per-message-key" {
+		t.Fatalf("got exchange=%q routingKey=%q, want the message's own dead-letter route", exchange, routingKey)
+	}
+}
+
+func TestDelayedExchangeReleasesMessagesInOrder(t *testing.T) {
+	now := time.Unix(1000, 0)
+	exchange := &DelayedExchange{}
+
+	late := &Message{ID: 1, DelayUntil: now.Add(2 * time.Second)}
+	early := &Message{ID: 2, DelayUntil: now.Add(time.Second)}
+	exchange.Schedule(late, now)
+	exchange.Schedule(early, now)
+
+	if got := exchange.Len(); got != 2 {
+		t.Fatalf("Len() = %d, want 2", got)
+	}
+	if ready := exchange.Ready(now); len(ready) != 0 {
+		t.Fatalf("Ready(now) = %d messages, want 0 before either DelayUntil", len(ready))
+	}
+
+	ready := exchange.Ready(now.Add(time.Second))
+	if len(ready) != 1 || ready[0] != early {
+		t.Fatalf("Ready() = %+v, want only the earlier message", ready)
+	}
+
+	ready = exchange.Ready(now.Add(2 * time.Second))
+	if len(ready) != 1 || ready[0] != late {
+		t.Fatalf("Ready() = %+v, want the remaining message", ready)
+	}
+	if got := exchange.Len(); got != 0 {
+		t.Fatalf("Len() = %d, want 0 after draining", got)
+	}
+}
+
+// TestDelayedExchangeScheduleIgnoresNonDelayedMessage verifies Schedule
+// is a no-op for a message that is not actually delayed, so callers can
+// route every published message through it unconditionally.
+func TestDelayedExchangeScheduleIgnoresNonDelayedMessage(t *testing.T) {
+	exchange := &DelayedExchange{}
+	exchange.Schedule(&Message{ID: 1}, time.Unix(1000, 0))
+
+	if got := exchange.Len(); got != 0 {
+		t.Fatalf("Len() = %d, want 0 for a non-delayed message", got)
+	}
+}
@@ -3,6 +3,7 @@ package amqp
 import (
 	"bytes"
 	"sync/atomic"
+	"time"
 )
 
 type Table map[string]interface{}
@@ -53,12 +54,112 @@ type Message struct {
 	Body          []*Frame
 	DeliveryCount uint32
 	ConfirmMeta   ConfirmMeta
+
+	// span covers this message's lifecycle from NewMessage through
+	// Append and SetHeader. It is opened against ActiveTracer and closed
+	// by FinishPublish once the publish has been routed and confirmed.
+	span Span
+	// spanCtx is the context produced for span, propagated into the
+	// message's headers by SetHeader so Enqueue/Deliver downstream (and
+	// a re-published copy on disk) can continue the same trace.
+	spanCtx *SpanContext
+
+	// OriginNodeID identifies the garagemq node that first accepted this
+	// message from a producer. It is empty until PrepareForReplication
+	// stamps it with the local node's ID before the message is first sent
+	// to peers; peers keep that ID when they re-publish it, so the origin
+	// node drops the message when it loops back.
+	OriginNodeID string
+	// ReplicationHopCount counts how many peers have re-published this
+	// message. Replication drops messages once the hop count exceeds
+	// MaxReplicationHops to bound gossip fan-out.
+	ReplicationHopCount uint32
+
+	// Expiration is the absolute deadline after which the queue must
+	// dead-letter or drop this message, computed from the `expiration`
+	// basic property or a queue-level TTL at publish time. Zero means no
+	// per-message expiration is set.
+	Expiration time.Time
+	// DeadLetterExchange and DeadLetterRoutingKey override the queue's
+	// own dead-letter configuration for this message, if set.
+	DeadLetterExchange   string
+	DeadLetterRoutingKey string
+	// DelayUntil holds the message back from routing until this time,
+	// for use by the delayed-message exchange type. Zero means deliver
+	// immediately.
+	DelayUntil time.Time
+	// XDeathHistory tracks each rejection/expiry hop this message has
+	// taken through a dead-letter exchange, following the `x-death`
+	// header convention.
+	XDeathHistory []XDeath
+}
+
+// XDeath records one hop of a message through a dead-letter exchange,
+// mirroring the `x-death` header array entries used by RabbitMQ and
+// garagemq so consumers can inspect why a message was redelivered.
+type XDeath struct {
+	Queue       string
+	Reason      string
+	Exchange    string
+	RoutingKeys []string
+	Count       uint64
+	Time        time.Time
+}
+
+// IsExpired reports whether the message's per-message TTL has elapsed.
+func (message *Message) IsExpired(now time.Time) bool {
+	return !message.Expiration.IsZero() && !now.Before(message.Expiration)
+}
+
+// IsDelayed reports whether the message must still be held by the
+// delayed-message exchange before it becomes eligible for routing.
+func (message *Message) IsDelayed(now time.Time) bool {
+	return !message.DelayUntil.IsZero() && now.Before(message.DelayUntil)
+}
+
+// HasDeadLetterRoute reports whether the message carries its own
+// dead-letter exchange, overriding the queue's configured one.
+func (message *Message) HasDeadLetterRoute() bool {
+	return message.DeadLetterExchange != ""
+}
+
+// RecordDeath records a hop of this message through a dead-letter
+// exchange, following the `x-death` header convention: a repeat hop
+// through the same queue/exchange/reason bumps that entry's Count and
+// refreshes its Time instead of growing XDeathHistory without bound, as
+// happens when a message is repeatedly nacked back into the same DLX.
+func (message *Message) RecordDeath(queue, reason, exchange string, routingKeys []string, now time.Time) {
+	for i := range message.XDeathHistory {
+		death := &message.XDeathHistory[i]
+		if death.Queue == queue && death.Exchange == exchange && death.Reason == reason {
+			death.Count++
+			death.Time = now
+			death.RoutingKeys = routingKeys
+			return
+		}
+	}
+	message.XDeathHistory = append(message.XDeathHistory, XDeath{
+		Queue:       queue,
+		Reason:      reason,
+		Exchange:    exchange,
+		RoutingKeys: routingKeys,
+		Count:       1,
+		Time:        now,
+	})
+}
+
+// IsReplicated reports whether this message carries an OriginNodeID: true
+// for a message that arrived via replication from another garagemq node,
+// and also for a locally published message once PrepareForReplication
+// has stamped it.
+func (message *Message) IsReplicated() bool {
+	return message.OriginNodeID != ""
 }
 
 var msgId uint64
 
 func NewMessage(method *BasicPublish) *Message {
-	return &Message{
+	message := &Message{
 		ID:            atomic.AddUint64(&msgId, 1),
 		Exchange:      method.Exchange,
 		RoutingKey:    method.RoutingKey,
@@ -67,9 +168,21 @@ func NewMessage(method *BasicPublish) *Message {
 		BodySize:      0,
 		DeliveryCount: 0,
 	}
+	message.span, message.spanCtx = ActiveTracer.StartSpan("amqp.publish", nil)
+	message.span.SetTag("exchange", message.Exchange)
+	message.span.SetTag("routing_key", message.RoutingKey)
+	message.span.SetTag("message.id", message.ID)
+	return message
 }
 
+// IsPersistent reports whether the message was published with delivery
+// mode 2. It returns false before the content header has been read (for
+// example while a span covering NewMessage is still open), rather than
+// panicking on the not-yet-populated Header.
 func (message *Message) IsPersistent() bool {
+	if message.Header == nil || message.Header.PropertyList == nil {
+		return false
+	}
 	deliveryMode := message.Header.PropertyList.DeliveryMode
 	return deliveryMode != nil && *deliveryMode == 2
 }
@@ -77,9 +190,104 @@ func (message *Message) IsPersistent() bool {
 func (message *Message) Append(body *Frame) {
 	message.Body = append(message.Body, body)
 	message.BodySize += uint64(len(body.Payload))
+	if message.span != nil {
+		message.span.SetTag("body.size", message.BodySize)
+	}
+}
+
+// SetHeader attaches the parsed content header to the message once its
+// frame has arrived, and finalizes the publish span opened by
+// NewMessage: its "persistent" tag - unknown until now - and any
+// SpanContext the producer carried in the headers table, which is
+// re-injected so it survives Marshal and is forwarded to consumers.
+func (message *Message) SetHeader(header *ContentHeader) {
+	message.Header = header
+	if message.span != nil {
+		message.span.SetTag("persistent", message.IsPersistent())
+	}
+	if parent, ok := message.ExtractSpanContext(ActiveTracer); ok {
+		message.spanCtx = parent
+	}
+	message.InjectSpanContext(ActiveTracer, message.spanCtx)
 }
 
+// FinishPublish closes the span opened by NewMessage once the publish
+// has been fully routed and, if applicable, confirmed.
+func (message *Message) FinishPublish() {
+	if message.span == nil {
+		return
+	}
+	message.span.SetTag("confirm.expected", message.ConfirmMeta.ExpectedConfirms)
+	message.span.SetTag("confirm.actual", message.ConfirmMeta.ActualConfirms)
+	message.span.Finish()
+	message.span = nil
+}
+
+// Enqueue starts and immediately finishes a span covering this message
+// being routed into queueName, continuing the trace carried by spanCtx
+// (from SetHeader) and re-injecting the context the span produces so it
+// is preserved across Marshal and any further routing hop.
+func (message *Message) Enqueue(queueName string) {
+	span, ctx := ActiveTracer.StartSpan("amqp.enqueue", message.spanCtx)
+	span.SetTag("queue", queueName)
+	for key, value := range message.TraceTags() {
+		span.SetTag(key, value)
+	}
+	message.spanCtx = ctx
+	message.InjectSpanContext(ActiveTracer, ctx)
+	span.Finish()
+}
+
+// Deliver starts and immediately finishes a span covering delivery of
+// this message to consumerTag, continuing the trace carried by spanCtx
+// and re-injecting the context the span produces so a redelivery keeps
+// the same trace.
+func (message *Message) Deliver(consumerTag string) {
+	span, ctx := ActiveTracer.StartSpan("amqp.deliver", message.spanCtx)
+	span.SetTag("consumer_tag", consumerTag)
+	for key, value := range message.TraceTags() {
+		span.SetTag(key, value)
+	}
+	message.spanCtx = ctx
+	message.InjectSpanContext(ActiveTracer, ctx)
+	span.Finish()
+}
+
+// Marshal encodes the message with the default codec (AMQPWireCodec),
+// prefixed with its one-byte codec tag so Unmarshal can dispatch back to
+// whichever codec produced the data, even after the default changes.
 func (message *Message) Marshal(protoVersion string) (data []byte, err error) {
+	return MarshalWithCodec(DefaultCodec, message, protoVersion)
+}
+
+// Unmarshal decodes a buffer produced by Marshal, reading the leading
+// codec tag byte to select the matching registered MessageCodec. This
+// lets a persisted database keep loading messages written by an older
+// codec after the server switches its default.
+//
+// Data written before codec tagging existed has no tag byte at all: its
+// first byte is just the high byte of the 8-byte message ID. Since that
+// byte will not collide with a registered codec tag until a single node
+// has stored 0xFE<<56 (about 1.8e19) messages or more, an unrecognized leading byte is
+// treated as that pre-tagging AMQPWireCodec layout and decoded whole,
+// rather than stripped.
+func (message *Message) Unmarshal(buffer []byte, protoVersion string) (err error) {
+	if len(buffer) == 0 {
+		return ErrEmptyMessageBuffer
+	}
+	codec, ok := codecsByTag[buffer[0]]
+	if !ok {
+		err = AMQPWireCodec{}.Unmarshal(message, buffer, protoVersion)
+	} else {
+		err = codec.Unmarshal(message, buffer[1:], protoVersion)
+	}
+	if err != nil {
+		return WrapChannelError(err, 541, "failed to decode persisted message", 60, 0)
+	}
+	return nil
+}
+
+func (codec AMQPWireCodec) marshal(message *Message, protoVersion string) (data []byte, err error) {
 	buffer := bytes.NewBuffer([]byte{})
 	if err = WriteLonglong(buffer, message.ID); err != nil {
 		return nil, err
@@ -110,10 +318,76 @@ func (message *Message) Marshal(protoVersion string) (data []byte, err error) {
 		return nil, err
 	}
 
+	if err = WriteShortstr(buffer, message.OriginNodeID); err != nil {
+		return nil, err
+	}
+	if err = WriteLong(buffer, message.ReplicationHopCount); err != nil {
+		return nil, err
+	}
+
+	if err = writeTime(buffer, message.Expiration); err != nil {
+		return nil, err
+	}
+	if err = WriteShortstr(buffer, message.DeadLetterExchange); err != nil {
+		return nil, err
+	}
+	if err = WriteShortstr(buffer, message.DeadLetterRoutingKey); err != nil {
+		return nil, err
+	}
+	if err = writeTime(buffer, message.DelayUntil); err != nil {
+		return nil, err
+	}
+	if err = WriteLong(buffer, uint32(len(message.XDeathHistory))); err != nil {
+		return nil, err
+	}
+	for _, death := range message.XDeathHistory {
+		if err = WriteShortstr(buffer, death.Queue); err != nil {
+			return nil, err
+		}
+		if err = WriteShortstr(buffer, death.Reason); err != nil {
+			return nil, err
+		}
+		if err = WriteShortstr(buffer, death.Exchange); err != nil {
+			return nil, err
+		}
+		if err = WriteLong(buffer, uint32(len(death.RoutingKeys))); err != nil {
+			return nil, err
+		}
+		for _, routingKey := range death.RoutingKeys {
+			if err = WriteShortstr(buffer, routingKey); err != nil {
+				return nil, err
+			}
+		}
+		if err = WriteLonglong(buffer, death.Count); err != nil {
+			return nil, err
+		}
+		if err = writeTime(buffer, death.Time); err != nil {
+			return nil, err
+		}
+	}
+
 	return buffer.Bytes(), nil
 }
 
-func (message *Message) Unmarshal(buffer []byte, protoVersion string) (err error) {
+func writeTime(buffer *bytes.Buffer, t time.Time) error {
+	if t.IsZero() {
+		return WriteLonglong(buffer, 0)
+	}
+	return WriteLonglong(buffer, uint64(t.UnixNano()))
+}
+
+func readTime(reader *bytes.Reader) (time.Time, error) {
+	nanos, err := ReadLonglong(reader)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if nanos == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, int64(nanos)), nil
+}
+
+func (codec AMQPWireCodec) unmarshal(message *Message, buffer []byte, protoVersion string) (err error) {
 	reader := bytes.NewReader(buffer)
 	if message.ID, err = ReadLonglong(reader); err != nil {
 		return err
@@ -143,42 +417,66 @@ func (message *Message) Unmarshal(buffer []byte, protoVersion string) (err error
 	if message.DeliveryCount, err = ReadLong(reader); err != nil {
 		return err
 	}
-	return nil
-}
-
-const (
-	ErrorOnConnection = iota
-	ErrorOnChannel
-)
 
-type Error struct {
-	ReplyCode uint16
-	ReplyText string
-	ClassId   uint16
-	MethodId  uint16
-	ErrorType int
-}
-
-func NewConnectionError(code uint16, text string, classId uint16, methodId uint16) *Error {
-	err := &Error{
-		ReplyCode: code,
-		ReplyText: ConstantsNameMap[code] + " - " + text,
-		ClassId:   classId,
-		MethodId:  methodId,
-		ErrorType: ErrorOnConnection,
+	if message.OriginNodeID, err = ReadShortstr(reader); err != nil {
+		return err
 	}
-
-	return err
-}
-
-func NewChannelError(code uint16, text string, classId uint16, methodId uint16) *Error {
-	err := &Error{
-		ReplyCode: code,
-		ReplyText: ConstantsNameMap[code] + " - " + text,
-		ClassId:   classId,
-		MethodId:  methodId,
-		ErrorType: ErrorOnChannel,
+	if message.ReplicationHopCount, err = ReadLong(reader); err != nil {
+		return err
 	}
 
-	return err
+	if message.Expiration, err = readTime(reader); err != nil {
+		return err
+	}
+	if message.DeadLetterExchange, err = ReadShortstr(reader); err != nil {
+		return err
+	}
+	if message.DeadLetterRoutingKey, err = ReadShortstr(reader); err != nil {
+		return err
+	}
+	if message.DelayUntil, err = readTime(reader); err != nil {
+		return err
+	}
+	// deathCount and routingKeyCount below come straight off the wire or
+	// disk, so they must not be used as a speculative slice capacity:
+	// a corrupted or truncated buffer could claim billions of entries
+	// and exhaust memory before the read loop ever fails. Appending
+	// without pre-sizing, as the body-frame loop above already does,
+	// only ever allocates as much as was actually read.
+	deathCount, err := ReadLong(reader)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < deathCount; i++ {
+		var death XDeath
+		if death.Queue, err = ReadShortstr(reader); err != nil {
+			return err
+		}
+		if death.Reason, err = ReadShortstr(reader); err != nil {
+			return err
+		}
+		if death.Exchange, err = ReadShortstr(reader); err != nil {
+			return err
+		}
+		routingKeyCount, err := ReadLong(reader)
+		if err != nil {
+			return err
+		}
+		for j := uint32(0); j < routingKeyCount; j++ {
+			routingKey, err := ReadShortstr(reader)
+			if err != nil {
+				return err
+			}
+			death.RoutingKeys = append(death.RoutingKeys, routingKey)
+		}
+		if death.Count, err = ReadLonglong(reader); err != nil {
+			return err
+		}
+		if death.Time, err = readTime(reader); err != nil {
+			return err
+		}
+		message.XDeathHistory = append(message.XDeathHistory, death)
+	}
+	return nil
 }
+